@@ -1,8 +1,12 @@
 package parse
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 )
 
@@ -37,6 +41,9 @@ type BinaryReader struct {
 	ord binary.ByteOrder
 	n   int64
 	err error
+
+	parent  *BinaryReader
+	secSize int64
 }
 
 // NewBinaryReader returns a BinaryReader that reads from r, with the byte order
@@ -103,6 +110,9 @@ func (r *BinaryReader) Bytes(p []byte) (failed bool) {
 
 // Number reads a number into v. v must be a pointer to any non-pointer type
 // accepted by NumberSize. Any other type panics.
+//
+// For a fixed type, the typed methods (Uint8, Int32, Float64, and so on) avoid
+// the type switch and pointer indirection required here.
 func (r *BinaryReader) Number(v interface{}) (failed bool) {
 	if r.err != nil {
 		return true
@@ -145,6 +155,208 @@ func (r *BinaryReader) Number(v interface{}) (failed bool) {
 	return false
 }
 
+// Uint8 reads a uint8.
+func (r *BinaryReader) Uint8() (v uint8, failed bool) {
+	var b [1]byte
+	if r.Bytes(b[:]) {
+		return 0, true
+	}
+	return b[0], false
+}
+
+// Uint16 reads a uint16.
+func (r *BinaryReader) Uint16() (v uint16, failed bool) {
+	var b [2]byte
+	if r.Bytes(b[:]) {
+		return 0, true
+	}
+	return r.ord.Uint16(b[:]), false
+}
+
+// Uint32 reads a uint32.
+func (r *BinaryReader) Uint32() (v uint32, failed bool) {
+	var b [4]byte
+	if r.Bytes(b[:]) {
+		return 0, true
+	}
+	return r.ord.Uint32(b[:]), false
+}
+
+// Uint64 reads a uint64.
+func (r *BinaryReader) Uint64() (v uint64, failed bool) {
+	var b [8]byte
+	if r.Bytes(b[:]) {
+		return 0, true
+	}
+	return r.ord.Uint64(b[:]), false
+}
+
+// Int8 reads an int8.
+func (r *BinaryReader) Int8() (v int8, failed bool) {
+	u, failed := r.Uint8()
+	return int8(u), failed
+}
+
+// Int16 reads an int16.
+func (r *BinaryReader) Int16() (v int16, failed bool) {
+	u, failed := r.Uint16()
+	return int16(u), failed
+}
+
+// Int32 reads an int32.
+func (r *BinaryReader) Int32() (v int32, failed bool) {
+	u, failed := r.Uint32()
+	return int32(u), failed
+}
+
+// Int64 reads an int64.
+func (r *BinaryReader) Int64() (v int64, failed bool) {
+	u, failed := r.Uint64()
+	return int64(u), failed
+}
+
+// Float32 reads a float32.
+func (r *BinaryReader) Float32() (v float32, failed bool) {
+	u, failed := r.Uint32()
+	if failed {
+		return 0, true
+	}
+	return math.Float32frombits(u), false
+}
+
+// Float64 reads a float64.
+func (r *BinaryReader) Float64() (v float64, failed bool) {
+	u, failed := r.Uint64()
+	if failed {
+		return 0, true
+	}
+	return math.Float64frombits(u), false
+}
+
+// Uvarint reads a variable-width unsigned integer, as encoded by
+// encoding/binary.PutUvarint, one byte at a time. Fails if the reader ends
+// before the varint is terminated, or if the value overflows 64 bits.
+func (r *BinaryReader) Uvarint() (v uint64, failed bool) {
+	if r.err != nil {
+		return 0, true
+	}
+	var x uint64
+	var s uint
+	for i := 0; i < binary.MaxVarintLen64; i++ {
+		var b [1]byte
+		if r.Bytes(b[:]) {
+			return 0, true
+		}
+		c := b[0]
+		if c < 0x80 {
+			if i == 9 && c > 1 {
+				r.err = errors.New("parse: uvarint overflows 64 bits")
+				return 0, true
+			}
+			return x | uint64(c)<<s, false
+		}
+		x |= uint64(c&0x7f) << s
+		s += 7
+	}
+	r.err = errors.New("parse: uvarint overflows 64 bits")
+	return 0, true
+}
+
+// Varint reads a variable-width signed integer, as encoded by
+// encoding/binary.PutVarint.
+func (r *BinaryReader) Varint() (v int64, failed bool) {
+	u, failed := r.Uvarint()
+	if failed {
+		return 0, true
+	}
+	x := int64(u >> 1)
+	if u&1 != 0 {
+		x = ^x
+	}
+	return x, false
+}
+
+// LenBytes reads a uvarint length prefix, then that many bytes.
+//
+// The length prefix is not trusted to size an allocation: bytes are read
+// incrementally from the underlying reader up to the prefixed length, so a
+// corrupt or malicious prefix cannot force an allocation larger than the data
+// actually available. Fails with io.ErrUnexpectedEOF if fewer bytes than the
+// prefix are available.
+func (r *BinaryReader) LenBytes() (p []byte, failed bool) {
+	n, failed := r.Uvarint()
+	if failed {
+		return nil, true
+	}
+	if n > math.MaxInt64 {
+		r.err = errors.New("parse: length prefix exceeds maximum")
+		return nil, true
+	}
+	var buf bytes.Buffer
+	read, err := buf.ReadFrom(io.LimitReader(r.r, int64(n)))
+	r.n += read
+	if err != nil {
+		r.err = err
+		return nil, true
+	}
+	if uint64(read) != n {
+		r.err = io.ErrUnexpectedEOF
+		return nil, true
+	}
+	return buf.Bytes(), false
+}
+
+// LenString is like LenBytes, but returns a string.
+func (r *BinaryReader) LenString() (s string, failed bool) {
+	p, failed := r.LenBytes()
+	if failed {
+		return "", true
+	}
+	return string(p), false
+}
+
+// Section returns a BinaryReader bounded to exactly size bytes read from r,
+// sharing r's byte order but with its own N and Err. r must not be read from
+// again until the section's EndSection method is called. Sections may be
+// nested.
+func (r *BinaryReader) Section(size int64) *BinaryReader {
+	return &BinaryReader{
+		r:       io.LimitReader(r.r, size),
+		ord:     r.ord,
+		parent:  r,
+		secSize: size,
+	}
+}
+
+// EndSection ends a section started by Section, and folds it back into the
+// reader it was created from. If the section did not read exactly the number
+// of bytes given to Section, then a descriptive error is set on the parent
+// reader, and any remaining bytes are discarded. Any sticky error on the
+// section is also propagated to the parent. Panics if r was not returned by
+// Section.
+func (r *BinaryReader) EndSection() (failed bool) {
+	p := r.parent
+	if p == nil {
+		panic("parse: EndSection called on a reader that is not a section")
+	}
+	r.parent = nil
+
+	if r.n != r.secSize {
+		if p.err == nil {
+			p.err = fmt.Errorf("parse: section: expected to read %d bytes, read %d", r.secSize, r.n)
+		}
+		if remaining := r.secSize - r.n; remaining > 0 {
+			n, _ := io.CopyN(ioutil.Discard, r.r, remaining)
+			r.n += n
+		}
+	}
+	if r.err != nil && p.err == nil {
+		p.err = r.err
+	}
+	p.n += r.n
+	return p.err != nil
+}
+
 // All reads all remaining bytes.
 func (r *BinaryReader) All() (data []byte, failed bool) {
 	if r.err != nil {
@@ -172,8 +384,24 @@ type BinaryWriter struct {
 	ord binary.ByteOrder
 	n   int64
 	err error
+
+	parent *BinaryWriter
+	buf    *bytes.Buffer
 }
 
+// SectionPrefix determines the length prefix, if any, written before a
+// section's contents by EndSection.
+type SectionPrefix int
+
+const (
+	// NoPrefix writes no length prefix.
+	NoPrefix SectionPrefix = iota
+	// UvarintPrefix writes the length as a uvarint.
+	UvarintPrefix
+	// Uint32Prefix writes the length as a fixed-width uint32.
+	Uint32Prefix
+)
+
 // NewBinaryWriter returns a BinaryWriter that writes to w, with the byte order
 // set to little endian.
 func NewBinaryWriter(w io.Writer) *BinaryWriter {
@@ -238,6 +466,9 @@ func (w *BinaryWriter) Bytes(p []byte) (failed bool) {
 
 // Number writes v as a number. v must be any non-pointer type accepted by
 // NumberSize. Any other type panics.
+//
+// For a fixed type, the typed methods (Uint8, Int32, Float64, and so on) avoid
+// the type switch required here.
 func (w *BinaryWriter) Number(v interface{}) (failed bool) {
 	if w.err != nil {
 		return true
@@ -276,3 +507,133 @@ func (w *BinaryWriter) Number(v interface{}) (failed bool) {
 	}
 	return w.Bytes(b)
 }
+
+// Uint8 writes a uint8.
+func (w *BinaryWriter) Uint8(v uint8) (failed bool) {
+	return w.Bytes([]byte{v})
+}
+
+// Uint16 writes a uint16.
+func (w *BinaryWriter) Uint16(v uint16) (failed bool) {
+	var b [2]byte
+	w.ord.PutUint16(b[:], v)
+	return w.Bytes(b[:])
+}
+
+// Uint32 writes a uint32.
+func (w *BinaryWriter) Uint32(v uint32) (failed bool) {
+	var b [4]byte
+	w.ord.PutUint32(b[:], v)
+	return w.Bytes(b[:])
+}
+
+// Uint64 writes a uint64.
+func (w *BinaryWriter) Uint64(v uint64) (failed bool) {
+	var b [8]byte
+	w.ord.PutUint64(b[:], v)
+	return w.Bytes(b[:])
+}
+
+// Int8 writes an int8.
+func (w *BinaryWriter) Int8(v int8) (failed bool) {
+	return w.Uint8(uint8(v))
+}
+
+// Int16 writes an int16.
+func (w *BinaryWriter) Int16(v int16) (failed bool) {
+	return w.Uint16(uint16(v))
+}
+
+// Int32 writes an int32.
+func (w *BinaryWriter) Int32(v int32) (failed bool) {
+	return w.Uint32(uint32(v))
+}
+
+// Int64 writes an int64.
+func (w *BinaryWriter) Int64(v int64) (failed bool) {
+	return w.Uint64(uint64(v))
+}
+
+// Float32 writes a float32.
+func (w *BinaryWriter) Float32(v float32) (failed bool) {
+	return w.Uint32(math.Float32bits(v))
+}
+
+// Float64 writes a float64.
+func (w *BinaryWriter) Float64(v float64) (failed bool) {
+	return w.Uint64(math.Float64bits(v))
+}
+
+// Uvarint writes v as a variable-width unsigned integer, using the minimum
+// number of bytes.
+func (w *BinaryWriter) Uvarint(v uint64) (failed bool) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	return w.Bytes(b[:n])
+}
+
+// Varint writes v as a variable-width signed integer, using the minimum
+// number of bytes.
+func (w *BinaryWriter) Varint(v int64) (failed bool) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(b[:], v)
+	return w.Bytes(b[:n])
+}
+
+// LenBytes writes a uvarint length prefix followed by p.
+func (w *BinaryWriter) LenBytes(p []byte) (failed bool) {
+	if w.Uvarint(uint64(len(p))) {
+		return true
+	}
+	return w.Bytes(p)
+}
+
+// LenString is like LenBytes, but writes the bytes of a string.
+func (w *BinaryWriter) LenString(s string) (failed bool) {
+	return w.LenBytes([]byte(s))
+}
+
+// Section returns a BinaryWriter that buffers writes in memory, sharing w's
+// byte order. The buffered content is flushed to w when the section's
+// EndSection method is called. Sections may be nested.
+func (w *BinaryWriter) Section() *BinaryWriter {
+	buf := &bytes.Buffer{}
+	return &BinaryWriter{
+		w:      buf,
+		ord:    w.ord,
+		parent: w,
+		buf:    buf,
+	}
+}
+
+// EndSection ends a section started by Section, and flushes its buffered
+// content to the writer it was created from, prefixed according to prefix.
+// Any sticky error on the section is propagated to the parent. Panics if w
+// was not returned by Section.
+func (w *BinaryWriter) EndSection(prefix SectionPrefix) (failed bool) {
+	p := w.parent
+	if p == nil {
+		panic("parse: EndSection called on a writer that is not a section")
+	}
+	w.parent = nil
+
+	if w.err != nil {
+		if p.err == nil {
+			p.err = w.err
+		}
+		return true
+	}
+	if p.err != nil {
+		return true
+	}
+
+	data := w.buf.Bytes()
+	switch prefix {
+	case UvarintPrefix:
+		p.Uvarint(uint64(len(data)))
+	case Uint32Prefix:
+		p.Uint32(uint32(len(data)))
+	}
+	p.Bytes(data)
+	return p.err != nil
+}
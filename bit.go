@@ -0,0 +1,233 @@
+package parse
+
+import "io"
+
+// BitOrder determines how bits are packed into and unpacked from a byte.
+type BitOrder int
+
+const (
+	// MSBFirst orders bits within a byte from most significant to least
+	// significant.
+	MSBFirst BitOrder = iota
+	// LSBFirst orders bits within a byte from least significant to most
+	// significant.
+	LSBFirst
+)
+
+// BitReader wraps an io.Reader to provide primitive methods for reading
+// sub-byte fields.
+//
+// Methods on BitReader that read return a bool indicating failure. If an
+// error occurs during any such call, then subsequent calls do nothing, and
+// return true. The error that occurred can be retrieved with the Err method.
+type BitReader struct {
+	r   io.Reader
+	ord BitOrder
+	buf byte
+	nb  uint
+	n   int64
+	err error
+}
+
+// NewBitReader returns a BitReader that reads from r, with the bit order set
+// to MSBFirst.
+func NewBitReader(r io.Reader) *BitReader {
+	return &BitReader{r: r, ord: MSBFirst}
+}
+
+// N returns the number of bytes read from the underlying reader.
+func (r *BitReader) N() (n int64) {
+	return r.n
+}
+
+// Err returns the first error that occurred while reading, if any.
+func (r *BitReader) Err() (err error) {
+	return r.err
+}
+
+// End returns the number of bytes read, and the first error that occurred.
+func (r *BitReader) End() (n int64, err error) {
+	return r.n, r.err
+}
+
+// SetBitOrder sets the order in which bits are unpacked from each byte.
+func (r *BitReader) SetBitOrder(order BitOrder) {
+	r.ord = order
+}
+
+// Align discards any unread bits remaining in the current byte, so that the
+// next read starts on a byte boundary.
+func (r *BitReader) Align() {
+	r.buf = 0
+	r.nb = 0
+}
+
+// fill reads the next byte from the underlying reader if the current byte has
+// been exhausted.
+func (r *BitReader) fill() (failed bool) {
+	if r.nb > 0 {
+		return false
+	}
+	var b [1]byte
+	n, err := io.ReadFull(r.r, b[:])
+	r.n += int64(n)
+	r.err = err
+	if r.err != nil {
+		return true
+	}
+	r.buf = b[0]
+	r.nb = 8
+	return false
+}
+
+// BoolBit reads a single bit.
+func (r *BitReader) BoolBit() (v bool, failed bool) {
+	if r.err != nil {
+		return false, true
+	}
+	if r.fill() {
+		return false, true
+	}
+	if r.ord == LSBFirst {
+		v = r.buf&1 != 0
+		r.buf >>= 1
+	} else {
+		v = r.buf&0x80 != 0
+		r.buf <<= 1
+	}
+	r.nb--
+	return v, false
+}
+
+// Bits reads n bits, from 0 to 64, and assembles them into a value with the
+// first bit read as the most significant bit of the n-bit result. Panics if n
+// is greater than 64.
+func (r *BitReader) Bits(n uint) (v uint64, failed bool) {
+	if n > 64 {
+		panic("bit count exceeds 64")
+	}
+	for i := uint(0); i < n; i++ {
+		b, failed := r.BoolBit()
+		if failed {
+			return 0, true
+		}
+		v <<= 1
+		if b {
+			v |= 1
+		}
+	}
+	return v, false
+}
+
+// BitWriter wraps an io.Writer to provide primitive methods for writing
+// sub-byte fields.
+//
+// Methods on BitWriter that write return a bool indicating failure. If an
+// error occurs during any such call, then subsequent calls do nothing, and
+// return true. The error that occurred can be retrieved with the Err method.
+//
+// A partial byte is buffered internally as bits are written. Callers must
+// call Align or Close at the end of the stream, or the final partial byte
+// will not be emitted.
+type BitWriter struct {
+	w   io.Writer
+	ord BitOrder
+	buf byte
+	nb  uint
+	n   int64
+	err error
+}
+
+// NewBitWriter returns a BitWriter that writes to w, with the bit order set
+// to MSBFirst.
+func NewBitWriter(w io.Writer) *BitWriter {
+	return &BitWriter{w: w, ord: MSBFirst}
+}
+
+// N returns the number of bytes written to the underlying writer.
+func (w *BitWriter) N() (n int64) {
+	return w.n
+}
+
+// Err returns the first error that occurred while writing, if any.
+func (w *BitWriter) Err() (err error) {
+	return w.err
+}
+
+// End returns the number of bytes written, and the first error that occurred.
+func (w *BitWriter) End() (n int64, err error) {
+	return w.n, w.err
+}
+
+// SetBitOrder sets the order in which bits are packed into each byte.
+func (w *BitWriter) SetBitOrder(order BitOrder) {
+	w.ord = order
+}
+
+// flush writes the buffered partial byte to the underlying writer, padding
+// any unwritten bits with zero.
+func (w *BitWriter) flush() (failed bool) {
+	if w.nb == 0 {
+		return false
+	}
+	n, err := w.w.Write([]byte{w.buf})
+	w.n += int64(n)
+	w.err = err
+	w.buf = 0
+	w.nb = 0
+	if w.err != nil {
+		return true
+	}
+	return false
+}
+
+// Align flushes the buffered partial byte, padding any unwritten bits with
+// zero, so that the next write starts on a byte boundary.
+func (w *BitWriter) Align() (failed bool) {
+	if w.err != nil {
+		return true
+	}
+	return w.flush()
+}
+
+// Close flushes the buffered partial byte, and returns the first error that
+// occurred while writing, if any.
+func (w *BitWriter) Close() (err error) {
+	w.Align()
+	return w.err
+}
+
+// WriteBoolBit writes a single bit.
+func (w *BitWriter) WriteBoolBit(v bool) (failed bool) {
+	if w.err != nil {
+		return true
+	}
+	if w.ord == LSBFirst {
+		if v {
+			w.buf |= 1 << w.nb
+		}
+	} else {
+		if v {
+			w.buf |= 0x80 >> w.nb
+		}
+	}
+	w.nb++
+	if w.nb == 8 {
+		return w.flush()
+	}
+	return false
+}
+
+// WriteBits writes the low n bits of v, from 0 to 64, with the most
+// significant of the n bits written first. Panics if n is greater than 64.
+func (w *BitWriter) WriteBits(v uint64, n uint) (failed bool) {
+	if n > 64 {
+		panic("bit count exceeds 64")
+	}
+	for i := int(n) - 1; i >= 0; i-- {
+		if w.WriteBoolBit(v>>uint(i)&1 != 0) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,16 +2,48 @@ package parse
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"io"
 	"io/ioutil"
+	"unicode/utf8"
 )
 
+// maxLookahead is the maximum number of bytes that a Checkpoint returned by
+// Mark can be rewound to by Restore.
+const maxLookahead = 4096
+
+// Position describes a location within text read by a TextReader.
+type Position struct {
+	// Offset is the number of bytes preceding the position.
+	Offset int64
+	// Line is the one-based line number of the position.
+	Line int64
+	// Column is the one-based column number of the position, in runes, since
+	// the start of the line.
+	Column int64
+}
+
+// Checkpoint is an opaque snapshot of a TextReader's state, returned by Mark
+// and consumed by Restore.
+type Checkpoint struct {
+	n    int64
+	mark int64
+	pos  Position
+	err  error
+	cr   bool
+}
+
 // TextReader wraps an io.Reader to provide primitive methods for parsing text.
 type TextReader struct {
-	r   *bufio.Reader
-	buf []byte
-	n   int64
-	err error
+	r    *bufio.Reader
+	buf  []byte
+	n    int64
+	err  error
+	pos  Position
+	ring []byte
+	rec  int64
+	cr   bool
 }
 
 // NewTextReader returns a TextReader that reads r.
@@ -23,6 +55,7 @@ func NewTextReader(r io.Reader) *TextReader {
 	return &TextReader{
 		r:   br,
 		buf: make([]byte, 64),
+		pos: Position{Line: 1, Column: 1},
 	}
 }
 
@@ -41,19 +74,125 @@ func (r *TextReader) End() (n int64, err error) {
 	return r.n, r.err
 }
 
+// Position returns the current line/column position of the cursor.
+func (t *TextReader) Position() Position {
+	return t.pos
+}
+
+// Mark returns a Checkpoint of the reader's current state, which can later be
+// passed to Restore to rewind the reader back to this point.
+//
+// A Checkpoint is only valid for as long as no more than maxLookahead bytes
+// are read from the reader after it is taken; reading further than that
+// causes Restore to fail.
+func (t *TextReader) Mark() Checkpoint {
+	return Checkpoint{n: t.n, mark: t.rec, pos: t.pos, err: t.err, cr: t.cr}
+}
+
+// Restore rewinds the reader to the state it was in when c was returned by
+// Mark. Returns an error, without modifying the reader, if c is ahead of the
+// reader's current position (as when c was taken by a different reader, or
+// after the checkpoint most recently restored), or if more than maxLookahead
+// bytes have been read since c was taken.
+func (t *TextReader) Restore(c Checkpoint) error {
+	delta := t.rec - c.mark
+	if delta < 0 {
+		return errors.New("parse: checkpoint is ahead of the reader")
+	}
+	if delta > int64(len(t.ring)) {
+		return errors.New("parse: checkpoint is outside the lookahead window")
+	}
+	if delta > 0 {
+		replay := make([]byte, delta)
+		copy(replay, t.ring[int64(len(t.ring))-delta:])
+		t.r = bufio.NewReader(io.MultiReader(bytes.NewReader(replay), t.r))
+		t.ring = t.ring[:int64(len(t.ring))-delta]
+		t.rec = c.mark
+	}
+	t.n = c.n
+	t.pos = c.pos
+	t.err = c.err
+	t.cr = c.cr
+	return nil
+}
+
+// advance updates the cursor position for the rune c, which was just decoded
+// from raw, the literal bytes read from the underlying reader, and records
+// raw so that it can be replayed by Restore.
+//
+// raw must hold exactly the bytes the reader consumed to produce c; it must
+// not be re-derived by re-encoding c; for invalid UTF-8, c is utf8.RuneError,
+// which re-encodes to different bytes than were actually read, and splicing
+// those fabricated bytes back in on Restore would corrupt the stream.
+func (t *TextReader) advance(c rune, raw []byte) {
+	t.pos.Offset += int64(len(raw))
+	switch c {
+	case '\n':
+		if !t.cr {
+			t.pos.Line++
+			t.pos.Column = 1
+		}
+		t.cr = false
+	case '\r':
+		t.pos.Line++
+		t.pos.Column = 1
+		t.cr = true
+	default:
+		t.pos.Column++
+		t.cr = false
+	}
+	t.record(raw)
+}
+
+// record appends b to the lookahead ring buffer, evicting the oldest bytes if
+// the buffer would exceed maxLookahead.
+func (t *TextReader) record(b []byte) {
+	t.rec += int64(len(b))
+	if len(b) >= maxLookahead {
+		t.ring = append(t.ring[:0], b[len(b)-maxLookahead:]...)
+		return
+	}
+	if over := len(t.ring) + len(b) - maxLookahead; over > 0 {
+		t.ring = t.ring[over:]
+	}
+	t.ring = append(t.ring, b...)
+}
+
+// peekRune decodes the next rune from the reader without consuming it,
+// returning the raw bytes it was encoded as. Callers that consume the rune
+// must Discard len(raw) bytes from t.r afterward, once they are done using
+// raw (Discard invalidates the slice returned by Peek). err is io.EOF if the
+// reader is exhausted.
+func (t *TextReader) peekRune() (c rune, raw []byte, err error) {
+	b, err := t.r.Peek(utf8.UTFMax)
+	if len(b) == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return 0, nil, err
+	}
+	c, w := utf8.DecodeRune(b)
+	return c, b[:w], nil
+}
+
 // Next returns the next rune from the reader, and advances the cursor by the
 // length of the rune. Returns r < 0 if an error occurred.
 func (t *TextReader) Next() (r rune) {
 	if t.err != nil {
 		return -1
 	}
-	var w int
-	r, w, t.err = t.r.ReadRune()
-	if t.err != nil {
+	c, raw, err := t.peekRune()
+	if err != nil {
+		t.err = err
 		return -1
 	}
-	t.n += int64(w)
-	return r
+	t.n += int64(len(raw))
+	t.advance(c, raw)
+	if _, err := t.r.Discard(len(raw)); err != nil {
+		t.err = err
+		return -1
+	}
+	return c
 }
 
 // MustNext is like Next, but sets the error to io.ErrUnexpectedEOF if the
@@ -90,8 +229,13 @@ func (t *TextReader) Is(s string) (ok bool) {
 	if string(b) != s {
 		return false
 	}
-	t.r.Discard(len(s))
+	for rest := b; len(rest) > 0; {
+		c, w := utf8.DecodeRune(rest)
+		t.advance(c, rest[:w])
+		rest = rest[w:]
+	}
 	t.n += int64(len(s))
+	t.r.Discard(len(s))
 	return true
 }
 
@@ -104,21 +248,24 @@ func (t *TextReader) IsAny(f func(rune) bool) (s string, ok bool) {
 	}
 	t.buf = t.buf[:0]
 	for {
-		var c rune
-		var w int
-		if c, w, t.err = t.r.ReadRune(); t.err != nil {
-			if t.err == io.EOF {
-				t.err = nil
+		c, raw, err := t.peekRune()
+		if err != nil {
+			if err == io.EOF {
 				return string(t.buf), true
 			}
+			t.err = err
 			return "", false
 		}
 		if !f(c) {
-			t.r.UnreadRune()
 			return string(t.buf), true
 		}
 		t.buf = append(t.buf, string(c)...)
-		t.n += int64(w)
+		t.n += int64(len(raw))
+		t.advance(c, raw)
+		if _, err := t.r.Discard(len(raw)); err != nil {
+			t.err = err
+			return "", false
+		}
 	}
 }
 
@@ -138,20 +285,23 @@ func (t *TextReader) Skip(f func(rune) bool) (ok bool) {
 		return false
 	}
 	for {
-		var c rune
-		var w int
-		if c, w, t.err = t.r.ReadRune(); t.err != nil {
-			if t.err == io.EOF {
-				t.err = nil
+		c, raw, err := t.peekRune()
+		if err != nil {
+			if err == io.EOF {
 				return true
 			}
+			t.err = err
 			return false
 		}
 		if !f(c) {
-			t.r.UnreadRune()
 			return true
 		}
-		t.n += int64(w)
+		t.n += int64(len(raw))
+		t.advance(c, raw)
+		if _, err := t.r.Discard(len(raw)); err != nil {
+			t.err = err
+			return false
+		}
 	}
 }
 
@@ -163,19 +313,24 @@ func (t *TextReader) Until(v rune) (s string, ok bool) {
 	}
 	t.buf = t.buf[:0]
 	for {
-		var c rune
-		var w int
-		if c, w, t.err = t.r.ReadRune(); t.err != nil {
-			if t.err == io.EOF {
-				t.err = io.ErrUnexpectedEOF
+		c, raw, err := t.peekRune()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
 			}
+			t.err = err
+			return "", false
+		}
+		t.n += int64(len(raw))
+		t.advance(c, raw)
+		if _, err := t.r.Discard(len(raw)); err != nil {
+			t.err = err
 			return "", false
 		}
 		if c == v {
 			return string(t.buf), true
 		}
 		t.buf = append(t.buf, string(c)...)
-		t.n += int64(w)
 	}
 }
 
@@ -187,19 +342,24 @@ func (t *TextReader) UntilAny(f func(rune) bool) (s string, ok bool) {
 	}
 	t.buf = t.buf[:0]
 	for {
-		var c rune
-		var w int
-		if c, w, t.err = t.r.ReadRune(); t.err != nil {
-			if t.err == io.EOF {
-				t.err = io.ErrUnexpectedEOF
+		c, raw, err := t.peekRune()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
 			}
+			t.err = err
+			return "", false
+		}
+		t.n += int64(len(raw))
+		t.advance(c, raw)
+		if _, err := t.r.Discard(len(raw)); err != nil {
+			t.err = err
 			return "", false
 		}
 		if f(c) {
 			return string(t.buf), true
 		}
 		t.buf = append(t.buf, string(c)...)
-		t.n += int64(w)
 	}
 }
 
@@ -213,5 +373,15 @@ func (t *TextReader) UntilEOF() (s string, ok bool) {
 		return "", false
 	}
 	t.n += int64(len(b))
+	// Decode widths directly from the bytes rather than recomputing them from
+	// the decoded rune with utf8.RuneLen: for invalid UTF-8, RuneLen(RuneError)
+	// reports the width of the re-encoded replacement character (3), not the
+	// width actually consumed, which would corrupt the lookahead ring used by
+	// Restore.
+	for rest := b; len(rest) > 0; {
+		c, w := utf8.DecodeRune(rest)
+		t.advance(c, rest[:w])
+		rest = rest[w:]
+	}
 	return string(b), true
 }
@@ -0,0 +1,74 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTextReaderMarkRestore(t *testing.T) {
+	r := NewTextReader(strings.NewReader("abcdef"))
+	r.Next()
+	r.Next()
+	m := r.Mark()
+	r.Next()
+	r.Next()
+	if err := r.Restore(m); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if s, ok := r.UntilEOF(); !ok || s != "cdef" {
+		t.Fatalf("UntilEOF() = %q, %v; want %q, true", s, ok, "cdef")
+	}
+}
+
+// TestTextReaderMarkRestoreInvalidUTF8 verifies that Restore replays the
+// literal bytes read from the underlying reader, not a re-encoding of the
+// runes decoded from them. Re-encoding U+FFFD for invalid UTF-8 would splice
+// fabricated bytes back in front of the live reader, silently corrupting the
+// stream.
+func TestTextReaderMarkRestoreInvalidUTF8(t *testing.T) {
+	r := NewTextReader(strings.NewReader("a\xC0\xBF\xBFz"))
+	if c := r.Next(); c != 'a' {
+		t.Fatalf("Next() = %q; want 'a'", c)
+	}
+	m := r.Mark()
+	if c := r.Next(); c != 0xFFFD {
+		t.Fatalf("Next() = %U; want U+FFFD", c)
+	}
+	if err := r.Restore(m); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	want := []rune{0xFFFD, 0xFFFD, 0xFFFD, 'z'}
+	for i, w := range want {
+		if c := r.Next(); c != w {
+			t.Fatalf("Next() #%d = %U; want %U", i, c, w)
+		}
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("Err() = %v; want nil", err)
+	}
+}
+
+func TestTextReaderRestoreOutsideLookahead(t *testing.T) {
+	r := NewTextReader(strings.NewReader(strings.Repeat("a", maxLookahead+1)))
+	m := r.Mark()
+	for i := 0; i < maxLookahead+1; i++ {
+		r.Next()
+	}
+	if err := r.Restore(m); err == nil {
+		t.Fatal("Restore succeeded; want error for checkpoint outside the lookahead window")
+	}
+}
+
+func TestTextReaderOffsetNConsistency(t *testing.T) {
+	r := NewTextReader(strings.NewReader("abc,def"))
+	s, ok := r.Until(',')
+	if !ok {
+		t.Fatal("Until: failed")
+	}
+	if s != "abc" {
+		t.Fatalf("Until() = %q; want %q", s, "abc")
+	}
+	if r.N() != r.Position().Offset {
+		t.Errorf("N()=%d != Position().Offset=%d", r.N(), r.Position().Offset)
+	}
+}